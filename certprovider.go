@@ -0,0 +1,98 @@
+package libp2ptls
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+// CertificateProvider supplies the certificate an Identity presents during a
+// TLS handshake. It's consulted once per handshake (via tls.Config's
+// GetCertificate/GetClientCertificate), so an implementation is free to swap
+// in a freshly signed certificate at any time without affecting handshakes
+// already in flight.
+type CertificateProvider interface {
+	// Current returns the certificate that should be presented for the next
+	// handshake. It must be safe to call concurrently with Rotate.
+	Current() *tls.Certificate
+	// Rotate generates a new certificate and makes it the one Current
+	// returns from then on.
+	Rotate(ctx context.Context) error
+}
+
+// staticCertificateProvider always returns the same certificate. It backs
+// NewIdentity, preserving the historical behavior of generating one
+// self-signed certificate for the lifetime of the Identity.
+type staticCertificateProvider struct {
+	cert *tls.Certificate
+}
+
+func (p staticCertificateProvider) Current() *tls.Certificate   { return p.cert }
+func (p staticCertificateProvider) Rotate(context.Context) error { return nil }
+
+// rotatingCertificateProvider is the CertificateProvider returned by
+// NewRotatingCertificateProvider, for callers that want automatic rotation
+// via WithCertificateProvider: it keeps a
+// self-signed libp2p certificate in memory and re-signs it, using the same
+// private key, whenever it's older than interval.
+type rotatingCertificateProvider struct {
+	privKey  ci.PrivKey
+	interval time.Duration
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	rotatedAt time.Time
+}
+
+// NewRotatingCertificateProvider returns a CertificateProvider that holds a
+// self-signed libp2p certificate in memory and transparently re-signs it
+// with privKey every interval. Pass it to WithCertificateProvider to enable
+// certificate rotation on a Transport.
+func NewRotatingCertificateProvider(privKey ci.PrivKey, interval time.Duration) (CertificateProvider, error) {
+	cert, err := keyToCertificate(privKey)
+	if err != nil {
+		return nil, err
+	}
+	return &rotatingCertificateProvider{
+		privKey:   privKey,
+		interval:  interval,
+		cert:      cert,
+		rotatedAt: time.Now(),
+	}, nil
+}
+
+// Current returns the most recently signed certificate, transparently
+// rotating it first if it's older than p.interval.
+func (p *rotatingCertificateProvider) Current() *tls.Certificate {
+	p.mu.RLock()
+	stale := p.interval > 0 && time.Since(p.rotatedAt) >= p.interval
+	cert := p.cert
+	p.mu.RUnlock()
+	if !stale {
+		return cert
+	}
+	// Best-effort: if signing a new certificate fails, keep serving the one
+	// we have. It remains valid until certValidityPeriod/2 after it was
+	// signed.
+	_ = p.Rotate(context.Background())
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cert
+}
+
+// Rotate signs a fresh certificate and swaps it in atomically, so a
+// concurrent Current() never observes a torn cert/key pair.
+func (p *rotatingCertificateProvider) Rotate(_ context.Context) error {
+	cert, err := keyToCertificate(p.privKey)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.cert = cert
+	p.rotatedAt = time.Now()
+	p.mu.Unlock()
+	return nil
+}
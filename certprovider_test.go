@@ -0,0 +1,110 @@
+package libp2ptls
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+// TestRotatingCertificateProviderRotates checks that Current starts serving
+// a newly signed certificate once the rotation interval has elapsed.
+func TestRotatingCertificateProviderRotates(t *testing.T) {
+	priv, _, err := ci.GenerateECDSAKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewRotatingCertificateProvider(priv, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := provider.Current()
+	time.Sleep(10 * time.Millisecond)
+	second := provider.Current()
+
+	if string(first.Certificate[0]) == string(second.Certificate[0]) {
+		t.Fatal("expected Current to return a freshly signed certificate after the rotation interval elapsed")
+	}
+}
+
+// TestTransportServesValidCertAfterRotation checks that a long-running
+// Transport keeps completing handshakes after its certificate has rotated.
+func TestTransportServesValidCertAfterRotation(t *testing.T) {
+	serverPriv, _, err := ci.GenerateECDSAKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewRotatingCertificateProvider(serverPriv, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverTr, err := New(serverPriv, WithCertificateProvider(provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := provider.Rotate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	clientTr, _ := newTestTransport(t)
+	clientInsecure, serverInsecure := net.Pipe()
+
+	serverErrCh := make(chan error, 1)
+	go func() {
+		_, err := serverTr.SecureInbound(context.Background(), serverInsecure)
+		serverErrCh <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := clientTr.SecureOutbound(ctx, clientInsecure, serverTr.localPeer); err != nil {
+		t.Fatalf("client handshake failed after server cert rotation: %s", err)
+	}
+	if err := <-serverErrCh; err != nil {
+		t.Fatalf("server handshake failed after cert rotation: %s", err)
+	}
+}
+
+// TestRotatingCertificateProviderConcurrentAccess exercises Current and
+// Rotate concurrently under the race detector, to catch a torn cert/key pair
+// being handed out mid-rotation.
+func TestRotatingCertificateProviderConcurrentAccess(t *testing.T) {
+	priv, _, err := ci.GenerateECDSAKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewRotatingCertificateProvider(priv, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				cert := provider.Current()
+				if cert == nil || cert.PrivateKey == nil {
+					t.Error("Current returned an incomplete certificate")
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 50; j++ {
+			if err := provider.Rotate(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,135 @@
+package libp2ptls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+// certValidityPeriod is the validity period of the self-signed certificate.
+// It is deliberately very long, since the certificate NewIdentity generates is
+// never renewed (only a rotating CertificateProvider re-signs one), and
+// we don't want to deal with certificate expiration during long-lived connections.
+const certValidityPeriod = 180 * 24 * time.Hour
+
+// certificatePrefix is prepended to the public key before signing, so that
+// the signature can't be used outside of the libp2p TLS handshake context.
+const certificatePrefix = "libp2p-tls-handshake:"
+
+// extensionID is the ASN.1 object identifier for the libp2p public key
+// extension, under the libp2p private enterprise number.
+var extensionID = []int{1, 3, 6, 1, 4, 1, 53594, 1, 1}
+
+// signedKey carries the libp2p public key and a signature over the
+// certificate's public key, proving ownership of the libp2p private key.
+type signedKey struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// keyToCertificate generates a new ECDSA key pair, creates a self-signed
+// certificate using that key, and embeds the libp2p extension, which
+// contains the node's libp2p public key and a signature binding it to the
+// certificate's key.
+func keyToCertificate(sk ci.PrivKey) (*tls.Certificate, error) {
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	certKeyPub, err := x509.MarshalPKIXPublicKey(certKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	signature, err := sk.Sign(append([]byte(certificatePrefix), certKeyPub...))
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := ci.MarshalPublicKey(sk.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	value, err := asn1.Marshal(signedKey{
+		PubKey:    keyBytes,
+		Signature: signature,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sn, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: sn,
+		NotBefore:    time.Now().Add(-certValidityPeriod / 2),
+		NotAfter:     time.Now().Add(certValidityPeriod / 2),
+		Subject:      pkix.Name{CommonName: "libp2p"},
+		ExtraExtensions: []pkix.Extension{
+			{Id: extensionID, Value: value},
+		},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, certKey.Public(), certKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{certDER},
+		PrivateKey:  certKey,
+	}, nil
+}
+
+// pubKeyFromCertChain extracts the libp2p public key embedded in the libp2p
+// extension of the peer's single certificate, verifying the signature
+// binding it to the certificate's key. The certificate's own self-signature
+// and validity period are not checked.
+func pubKeyFromCertChain(chain []*x509.Certificate) (ci.PubKey, error) {
+	if len(chain) != 1 {
+		return nil, errors.New("expected one certificate in the chain")
+	}
+	cert := chain[0]
+
+	var found bool
+	var sk signedKey
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(extensionID) {
+			continue
+		}
+		found = true
+		if _, err := asn1.Unmarshal(ext.Value, &sk); err != nil {
+			return nil, fmt.Errorf("unmarshalling signed certificate failed: %s", err)
+		}
+		break
+	}
+	if !found {
+		return nil, errors.New("expected certificate to contain a libp2p extension")
+	}
+
+	pubKey, err := ci.UnmarshalPublicKey(sk.PubKey)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling public key failed: %s", err)
+	}
+	certKeyPub, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	valid, err := pubKey.Verify(append([]byte(certificatePrefix), certKeyPub...), sk.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("signature verification failed: %s", err)
+	}
+	if !valid {
+		return nil, errors.New("signature invalid")
+	}
+	return pubKey, nil
+}
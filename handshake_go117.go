@@ -0,0 +1,16 @@
+//go:build go1.17
+// +build go1.17
+
+package libp2ptls
+
+import (
+	"context"
+	"crypto/tls"
+)
+
+// doHandshake runs the TLS handshake, delivering ctx cancellation natively
+// via tls.Conn.HandshakeContext (added in Go 1.17). This avoids racing
+// tlsConn.Close() against an in-flight Handshake() call.
+func doHandshake(ctx context.Context, tlsConn *tls.Conn) error {
+	return tlsConn.HandshakeContext(ctx)
+}
@@ -0,0 +1,43 @@
+//go:build !go1.17
+// +build !go1.17
+
+package libp2ptls
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+)
+
+// doHandshake runs the TLS handshake on Go versions before 1.17, which don't
+// have tls.Conn.HandshakeContext. There's no way to pass a context to
+// tls.Conn.Handshake() on these versions (see
+// https://github.com/golang/go/issues/18482), so cancellation is delivered
+// by closing the connection from a background goroutine instead.
+func doHandshake(ctx context.Context, tlsConn *tls.Conn) error {
+	select {
+	case <-ctx.Done():
+		tlsConn.Close()
+	default:
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Ensure that we do not return before either being done or having a
+	// context cancellation.
+	defer wg.Wait()
+	defer close(done)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			tlsConn.Close()
+		}
+	}()
+
+	return tlsConn.Handshake()
+}
@@ -0,0 +1,62 @@
+package libp2ptls
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// TestHandshakeCancellationReturnsContextError checks that cancelling the
+// context passed to SecureOutbound promptly returns ctx.Err(), without
+// leaking the goroutine doHandshake may have started to watch for
+// cancellation.
+func TestHandshakeCancellationReturnsContextError(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clientTr, serverPeer := newTestTransport(t)
+	clientInsecure, serverInsecure := net.Pipe()
+	defer serverInsecure.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := clientTr.SecureOutbound(ctx, clientInsecure, serverPeer)
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// TestHandshakeCancellationMidFlightDoesNotLeak checks that cancelling the
+// context while a handshake is genuinely in flight unblocks promptly and
+// doesn't leak doHandshake's cancellation-watching goroutine.
+func TestHandshakeCancellationMidFlightDoesNotLeak(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clientTr, serverPeer := newTestTransport(t)
+	clientInsecure, serverInsecure := net.Pipe()
+	defer serverInsecure.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := clientTr.SecureOutbound(ctx, clientInsecure, serverPeer)
+		errCh <- err
+	}()
+
+	// Give the handshake a moment to start, then cancel it. Nothing ever
+	// answers on serverInsecure, so without cancellation this would hang.
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SecureOutbound did not return promptly after cancellation")
+	}
+}
@@ -0,0 +1,207 @@
+package libp2ptls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// alpnPeerIDPrefix is prepended to a peer ID to turn it into an ALPN protocol
+// string. A client that already knows which peer it intends to dial
+// advertises this as one of its supported protocols in the ClientHello, so
+// that the server can reject an unexpected peer ID before the handshake
+// proceeds any further.
+const alpnPeerIDPrefix = "/libp2p/peerid/"
+
+// Identity is used to secure connections
+type Identity struct {
+	config tls.Config
+
+	// localPeer is the peer ID derived from the private key this Identity
+	// was created with. It's used to select this Identity out of a set of
+	// Identities sharing a single listener.
+	localPeer peer.ID
+
+	// sessionCache, when set, enables TLS 1.3 session resumption: outbound
+	// configs are keyed by the remote peer ID so that a repeat dial to the
+	// same peer can resume instead of performing a full handshake. See
+	// WithSessionCache.
+	sessionCache tls.ClientSessionCache
+
+	// ticketRotator rotates this Identity's server-side session ticket key,
+	// when session resumption is enabled. nil otherwise.
+	ticketRotator *sessionTicketKeyRotator
+
+	// tracer receives PeerVerified events once a handshake's certificate
+	// chain has been verified. Defaults to a no-op.
+	tracer Tracer
+}
+
+// NewIdentity creates a new identity, generating a single self-signed
+// certificate that's used for the lifetime of the Identity. Use
+// NewIdentityWithCertificateProvider instead if the certificate should be
+// rotated while the Identity is in use.
+func NewIdentity(privKey ci.PrivKey) (*Identity, error) {
+	cert, err := keyToCertificate(privKey)
+	if err != nil {
+		return nil, err
+	}
+	return newIdentity(privKey, staticCertificateProvider{cert})
+}
+
+// NewIdentityWithCertificateProvider creates a new identity that sources its
+// handshake certificate from provider instead of generating and freezing one
+// for the lifetime of the Identity, so a rotating provider can swap in a
+// freshly signed certificate without callers needing to recreate the
+// Identity.
+func NewIdentityWithCertificateProvider(privKey ci.PrivKey, provider CertificateProvider) (*Identity, error) {
+	return newIdentity(privKey, provider)
+}
+
+func newIdentity(privKey ci.PrivKey, provider CertificateProvider) (*Identity, error) {
+	localPeer, err := peer.IDFromPrivateKey(privKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{
+		localPeer: localPeer,
+		tracer:    noopTracer{},
+		config: tls.Config{
+			MinVersion:         tls.VersionTLS13,
+			InsecureSkipVerify: true,
+			ClientAuth:         tls.RequireAnyClientCert,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return provider.Current(), nil
+			},
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return provider.Current(), nil
+			},
+			VerifyPeerCertificate: func(_ [][]byte, _ [][]*x509.Certificate) error {
+				panic("tls config not specialized for peer")
+			},
+		},
+	}, nil
+}
+
+// ConfigForPeer creates a new single-use tls.Config that verifies the
+// certificate chain presented by the peer and delivers the verified public
+// key on the returned channel. If remote is non-empty, the returned config
+// also advertises remote as an ALPN protocol (see alpnProtocolForPeer), so a
+// server that multiplexes several Identities behind one listener can select
+// the right one, and a mismatched server can be rejected before the
+// handshake completes.
+func (i *Identity) ConfigForPeer(remote peer.ID) (*tls.Config, <-chan ci.PubKey) {
+	keyCh := make(chan ci.PubKey, 1)
+	return i.configForPeer(remote, keyCh), keyCh
+}
+
+// configForPeer is ConfigForPeer, but delivers the verified public key to a
+// caller-supplied channel instead of allocating its own. This lets a caller
+// that doesn't yet know which Identity it'll end up using (see
+// Transport.configForAnyIdentity) hand the same channel to whichever
+// Identity's config is ultimately selected, so the key is delivered
+// synchronously from within VerifyPeerCertificate - no separate goroutine
+// forwarding it into a second channel after the fact.
+func (i *Identity) configForPeer(remote peer.ID, keyCh chan<- ci.PubKey) *tls.Config {
+	conf := i.config.Clone()
+	// We need to check the peer ID in the VerifyPeerCertificate callback.
+	// The tls.Config is also used for listening, and we might also have
+	// outgoing connections with the same tls.Config. In order to prevent the
+	// tls.Config from performing verification for the wrong direction of
+	// connections, and to use the peer ID to verify the certificate (and not
+	// rely on the hostname), we use InsecureSkipVerify.
+	conf.InsecureSkipVerify = true
+	conf.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		defer close(keyCh)
+		chain := make([]*x509.Certificate, len(rawCerts))
+		for i := 0; i < len(rawCerts); i++ {
+			cert, err := x509.ParseCertificate(rawCerts[i])
+			if err != nil {
+				return err
+			}
+			chain[i] = cert
+		}
+		pubKey, err := pubKeyFromCertChain(chain)
+		if err != nil {
+			return err
+		}
+		if remote != "" && !remote.MatchesPublicKey(pubKey) {
+			peerID, err := peer.IDFromPublicKey(pubKey)
+			if err != nil {
+				peerID = peer.ID(fmt.Sprintf("(not determined: %s)", err.Error()))
+			}
+			return fmt.Errorf("peer IDs don't match: expected %s, got %s", remote, peerID)
+		}
+		verifiedPeer := remote
+		if verifiedPeer == "" {
+			if id, err := peer.IDFromPublicKey(pubKey); err == nil {
+				verifiedPeer = id
+			}
+		}
+		i.tracer.PeerVerified(verifiedPeer, pubKey.Type())
+		keyCh <- pubKey
+		return nil
+	}
+	if remote != "" {
+		conf.NextProtos = []string{alpnProtocolForPeer(remote)}
+		if i.sessionCache != nil {
+			// crypto/tls keys client session state by ServerName (falling
+			// back to the remote address, which is useless for libp2p,
+			// where the same peer can be reached at many addresses). Since
+			// we already skip certificate verification against the
+			// hostname, it's safe to repurpose ServerName as the peer ID.
+			conf.ServerName = remote.Pretty()
+			conf.ClientSessionCache = i.sessionCache
+		}
+	}
+	return conf
+}
+
+// enableSessionResumption wires a shared client session cache into this
+// Identity's outbound configs (see ConfigForPeer) and starts rotating the
+// session ticket key its inbound configs use to encrypt tickets.
+func (i *Identity) enableSessionResumption(cache tls.ClientSessionCache) {
+	i.sessionCache = cache
+	i.ticketRotator = startSessionTicketKeyRotator(&i.config, sessionTicketKeyRotationInterval)
+}
+
+// Close stops this Identity's session ticket key rotation goroutine, if
+// enableSessionResumption ever started one. It's a no-op otherwise, so it's
+// safe to call unconditionally.
+func (i *Identity) Close() error {
+	if i.ticketRotator != nil {
+		i.ticketRotator.Stop()
+	}
+	return nil
+}
+
+// ConfigForAny is used for accepting connections from any peer - the peer ID
+// isn't known in advance.
+func (i *Identity) ConfigForAny() (*tls.Config, <-chan ci.PubKey) {
+	return i.ConfigForPeer("")
+}
+
+// alpnProtocolForPeer encodes a peer ID as an ALPN protocol string.
+func alpnProtocolForPeer(p peer.ID) string {
+	return alpnPeerIDPrefix + p.Pretty()
+}
+
+// peerIDFromALPN looks for a peer ID hint among the ALPN protocols a client
+// offered in its ClientHello and decodes it, if present.
+func peerIDFromALPN(protos []string) (peer.ID, bool) {
+	for _, proto := range protos {
+		if !strings.HasPrefix(proto, alpnPeerIDPrefix) {
+			continue
+		}
+		p, err := peer.Decode(strings.TrimPrefix(proto, alpnPeerIDPrefix))
+		if err != nil {
+			continue
+		}
+		return p, true
+	}
+	return "", false
+}
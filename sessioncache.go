@@ -0,0 +1,74 @@
+package libp2ptls
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"sync"
+	"time"
+)
+
+// sessionTicketKeyRotationInterval is how often a server-side Identity with
+// session resumption enabled replaces its primary session ticket key.
+const sessionTicketKeyRotationInterval = 24 * time.Hour
+
+// sessionTicketKeyRotator periodically installs a freshly generated primary
+// session ticket key on a tls.Config, keeping the previous key around for
+// one more interval so tickets issued just before a rotation can still be
+// decrypted.
+type sessionTicketKeyRotator struct {
+	config   *tls.Config
+	interval time.Duration
+	stop     chan struct{}
+
+	mu       sync.Mutex
+	current  [32]byte
+	previous [32]byte
+}
+
+// startSessionTicketKeyRotator installs an initial session ticket key on
+// config and starts rotating it every interval. The returned rotator must be
+// stopped with Stop once config is no longer in use.
+func startSessionTicketKeyRotator(config *tls.Config, interval time.Duration) *sessionTicketKeyRotator {
+	r := &sessionTicketKeyRotator{config: config, interval: interval, stop: make(chan struct{})}
+	r.rotate()
+	go r.loop()
+	return r
+}
+
+func (r *sessionTicketKeyRotator) loop() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.rotate()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *sessionTicketKeyRotator) rotate() {
+	var next [32]byte
+	if _, err := rand.Read(next[:]); err != nil {
+		// crypto/rand only fails if the system CSPRNG is broken; there's
+		// nothing safe to do but keep using the previous keys.
+		return
+	}
+	r.mu.Lock()
+	r.previous = r.current
+	r.current = next
+	keys := [][32]byte{r.current}
+	// On the first rotation there is no previous key yet.
+	if r.previous != ([32]byte{}) {
+		keys = append(keys, r.previous)
+	}
+	r.config.SetSessionTicketKeys(keys)
+	r.mu.Unlock()
+}
+
+// Stop ends the rotation goroutine. The session ticket keys already
+// installed on config remain in place.
+func (r *sessionTicketKeyRotator) Stop() {
+	close(r.stop)
+}
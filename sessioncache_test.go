@@ -0,0 +1,147 @@
+package libp2ptls
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"go.uber.org/goleak"
+)
+
+// delayedConn wraps a net.Conn and sleeps before every Read, to simulate
+// network latency over an otherwise instantaneous connection.
+type delayedConn struct {
+	net.Conn
+	delay time.Duration
+}
+
+func (c *delayedConn) Read(b []byte) (int, error) {
+	time.Sleep(c.delay)
+	return c.Conn.Read(b)
+}
+
+// newDelayedPipe returns a connected, delayed TCP loopback pair rather than a
+// net.Pipe. A TLS 1.3 server writes its post-handshake session tickets
+// synchronously inside Handshake(); net.Pipe is unbuffered and has no
+// independent reader at that point, so that write - and the Handshake() call
+// making it - never returns. A real socket has kernel-buffered writes, so the
+// server can finish its handshake without the client needing to be reading
+// yet.
+func newDelayedPipe(t *testing.T, delay time.Duration) (net.Conn, net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	serverCh := make(chan net.Conn, 1)
+	acceptErrCh := make(chan error, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			acceptErrCh <- err
+			return
+		}
+		serverCh <- c
+	}()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case server := <-serverCh:
+		return &delayedConn{Conn: client, delay: delay}, &delayedConn{Conn: server, delay: delay}
+	case err := <-acceptErrCh:
+		t.Fatal(err)
+	}
+	return nil, nil
+}
+
+// dialOnce runs one outbound/inbound handshake pair over a fresh, delayed
+// pipe and returns the client's measured handshake duration and whether the
+// client's TLS session was resumed.
+func dialOnce(t *testing.T, clientTr, serverTr *Transport, delay time.Duration) (time.Duration, bool) {
+	t.Helper()
+	clientInsecure, serverInsecure := newDelayedPipe(t, delay)
+
+	serverErrCh := make(chan error, 1)
+	go func() {
+		c, err := serverTr.SecureInbound(context.Background(), serverInsecure)
+		if err == nil {
+			// Give the client something to read: crypto/tls only processes
+			// (and caches) the server's post-handshake session ticket on Read.
+			_, err = c.Write([]byte{0})
+		}
+		serverErrCh <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	clientConn, err := clientTr.SecureOutbound(ctx, clientInsecure, serverTr.localPeer)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("client handshake failed: %s", err)
+	}
+	if err := <-serverErrCh; err != nil {
+		t.Fatalf("server handshake failed: %s", err)
+	}
+	if _, err := io.ReadFull(clientConn, make([]byte, 1)); err != nil {
+		t.Fatalf("client read failed: %s", err)
+	}
+
+	tlsConn, ok := clientConn.(*conn)
+	if !ok {
+		t.Fatal("expected *conn")
+	}
+	return elapsed, tlsConn.ConnectionState().DidResume
+}
+
+// TestSessionResumption checks that a second dial to the same peer, using a
+// Transport configured with WithSessionCache, resumes the TLS session
+// instead of running a full handshake, and logs the measured handshake
+// latency with and without resumption over a pipe with artificial latency.
+func TestSessionResumption(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	const delay = 20 * time.Millisecond
+
+	serverPriv, _, err := ci.GenerateECDSAKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverTr, err := New(serverPriv, WithSessionCache(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverTr.Close()
+
+	clientPriv, _, err := ci.GenerateECDSAKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTr, err := New(clientPriv, WithSessionCache(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientTr.Close()
+
+	firstElapsed, firstResumed := dialOnce(t, clientTr, serverTr, delay)
+	if firstResumed {
+		t.Fatal("expected the first handshake to a peer to not resume a session")
+	}
+
+	secondElapsed, secondResumed := dialOnce(t, clientTr, serverTr, delay)
+	if !secondResumed {
+		t.Fatal("expected the second handshake to the same peer to resume the cached session")
+	}
+
+	t.Logf("handshake latency: first (full)=%s, second (resumed)=%s", firstElapsed, secondElapsed)
+}
@@ -0,0 +1,46 @@
+package libp2ptls
+
+import (
+	pb "github.com/libp2p/go-libp2p-core/crypto/pb"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Tracer receives structured events describing what happens during a
+// Transport's handshakes, so operators can wire them into their own
+// logging or metrics - e.g. Prometheus counters for handshake outcomes, or
+// histograms for handshake duration by key type - instead of scraping log
+// lines. Pass one to New via WithTracer.
+type Tracer interface {
+	// SimultaneousConnectDetected is called when SecureOutbound notices
+	// that the remote peer dialed us back at the same time, and is about
+	// to recover by waiting for the TLS alert the remote's client sends on
+	// receiving our ClientHello.
+	SimultaneousConnectDetected(remote peer.ID)
+	// AlertReceived is called once the alert expected after
+	// SimultaneousConnectDetected has been observed.
+	AlertReceived(remote peer.ID)
+	// RetryingAsClient is called when this side lost the simultaneous
+	// connect tie-break and is retrying the connection as the client.
+	RetryingAsClient(remote peer.ID)
+	// RetryingAsServer is called when this side won the simultaneous
+	// connect tie-break and is retrying the connection as the server.
+	RetryingAsServer(remote peer.ID)
+	// PeerVerified is called once a handshake's certificate chain has been
+	// verified and the peer's identity established.
+	PeerVerified(remote peer.ID, keyType pb.KeyType)
+	// HandshakeFailed is called when a handshake did not complete
+	// successfully, with the error that caused it to fail.
+	HandshakeFailed(err error)
+}
+
+// noopTracer is the default Tracer: every method is a no-op.
+type noopTracer struct{}
+
+func (noopTracer) SimultaneousConnectDetected(peer.ID) {}
+func (noopTracer) AlertReceived(peer.ID)               {}
+func (noopTracer) RetryingAsClient(peer.ID)            {}
+func (noopTracer) RetryingAsServer(peer.ID)            {}
+func (noopTracer) PeerVerified(peer.ID, pb.KeyType)    {}
+func (noopTracer) HandshakeFailed(error)               {}
+
+var _ Tracer = noopTracer{}
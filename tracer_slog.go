@@ -0,0 +1,53 @@
+//go:build go1.21
+// +build go1.21
+
+package libp2ptls
+
+import (
+	"log/slog"
+
+	pb "github.com/libp2p/go-libp2p-core/crypto/pb"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// SlogTracer adapts Tracer events to structured log/slog records, so a
+// Transport's handshake events can be sent wherever the rest of a program
+// already sends its logs.
+type SlogTracer struct {
+	logger *slog.Logger
+}
+
+var _ Tracer = &SlogTracer{}
+
+// NewSlogTracer returns a Tracer that logs each event to logger. A nil
+// logger falls back to slog.Default().
+func NewSlogTracer(logger *slog.Logger) *SlogTracer {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogTracer{logger: logger}
+}
+
+func (t *SlogTracer) SimultaneousConnectDetected(remote peer.ID) {
+	t.logger.Info("simultaneous connect detected", "remote", remote)
+}
+
+func (t *SlogTracer) AlertReceived(remote peer.ID) {
+	t.logger.Debug("received expected alert from simultaneous connect", "remote", remote)
+}
+
+func (t *SlogTracer) RetryingAsClient(remote peer.ID) {
+	t.logger.Debug("retrying simultaneous connect as client", "remote", remote)
+}
+
+func (t *SlogTracer) RetryingAsServer(remote peer.ID) {
+	t.logger.Debug("retrying simultaneous connect as server", "remote", remote)
+}
+
+func (t *SlogTracer) PeerVerified(remote peer.ID, keyType pb.KeyType) {
+	t.logger.Info("peer verified", "remote", remote, "key_type", keyType)
+}
+
+func (t *SlogTracer) HandshakeFailed(err error) {
+	t.logger.Warn("handshake failed", "error", err)
+}
@@ -0,0 +1,193 @@
+package libp2ptls
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	pb "github.com/libp2p/go-libp2p-core/crypto/pb"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// recordingTracer records every event it receives, in order, for assertions.
+type recordingTracer struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recordingTracer) record(event string) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+func (r *recordingTracer) SimultaneousConnectDetected(peer.ID) {
+	r.record("SimultaneousConnectDetected")
+}
+func (r *recordingTracer) AlertReceived(peer.ID)            { r.record("AlertReceived") }
+func (r *recordingTracer) RetryingAsClient(peer.ID)         { r.record("RetryingAsClient") }
+func (r *recordingTracer) RetryingAsServer(peer.ID)         { r.record("RetryingAsServer") }
+func (r *recordingTracer) PeerVerified(peer.ID, pb.KeyType) { r.record("PeerVerified") }
+func (r *recordingTracer) HandshakeFailed(error)            { r.record("HandshakeFailed") }
+
+var _ Tracer = &recordingTracer{}
+
+func (r *recordingTracer) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]string, len(r.events))
+	copy(out, r.events)
+	return out
+}
+
+func containsEvent(events []string, want string) bool {
+	for _, e := range events {
+		if e == want {
+			return true
+		}
+	}
+	return false
+}
+
+// eventIndex returns the position of the first occurrence of want in events,
+// or -1 if it isn't there.
+func eventIndex(events []string, want string) int {
+	for i, e := range events {
+		if e == want {
+			return i
+		}
+	}
+	return -1
+}
+
+// TestTracerSimultaneousConnect forces a genuine simultaneous connect - both
+// sides dial each other over the same connection at once - and checks that
+// the expected sequence of Tracer events fires on each side, in place of the
+// fmt.Println diagnostics this recovery path used to use.
+//
+// This needs a connection with real buffering, not a net.Pipe: both sides
+// write their ClientHello before either has called Read, and net.Pipe's
+// Write blocks until a matching Read is already in progress, so two
+// unbuffered writes racing like that deadlock before either side's unread
+// ClientHello can trigger the recovery path.
+func TestTracerSimultaneousConnect(t *testing.T) {
+	aPriv, _, err := ci.GenerateECDSAKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bPriv, _, err := ci.GenerateECDSAKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aPeer, err := peer.IDFromPrivateKey(aPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bPeer, err := peer.IDFromPrivateKey(bPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aTracer := &recordingTracer{}
+	bTracer := &recordingTracer{}
+
+	aTr, err := New(aPriv, WithTracer(aTracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bTr, err := New(bPriv, WithTracer(bTracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aInsecure, bInsecure := newDelayedPipe(t, 0)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		aTr.SecureOutbound(ctx, aInsecure, bPeer)
+	}()
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		bTr.SecureOutbound(ctx, bInsecure, aPeer)
+	}()
+	wg.Wait()
+
+	aEvents, bEvents := aTracer.snapshot(), bTracer.snapshot()
+	t.Logf("a: %v, b: %v", aEvents, bEvents)
+
+	for name, events := range map[string][]string{"a": aEvents, "b": bEvents} {
+		if !containsEvent(events, "SimultaneousConnectDetected") {
+			t.Errorf("%s: expected a SimultaneousConnectDetected event, got %v", name, events)
+		}
+		if !containsEvent(events, "AlertReceived") {
+			t.Errorf("%s: expected an AlertReceived event, got %v", name, events)
+		}
+		if !containsEvent(events, "RetryingAsClient") && !containsEvent(events, "RetryingAsServer") {
+			t.Errorf("%s: expected either a RetryingAsClient or RetryingAsServer event, got %v", name, events)
+		}
+		detected, alerted := eventIndex(events, "SimultaneousConnectDetected"), eventIndex(events, "AlertReceived")
+		retried := eventIndex(events, "RetryingAsClient")
+		if retried < 0 {
+			retried = eventIndex(events, "RetryingAsServer")
+		}
+		if detected >= 0 && alerted >= 0 && retried >= 0 && !(detected < alerted && alerted < retried) {
+			t.Errorf("%s: expected SimultaneousConnectDetected, AlertReceived and a retry event in that order, got %v", name, events)
+		}
+	}
+}
+
+// TestTracerFiresForAdditionalIdentity checks that an inbound handshake
+// resolving to an Identity registered via WithAdditionalIdentities reports
+// PeerVerified on the Transport's configured Tracer, not just a handshake
+// resolving to the primary identity.
+func TestTracerFiresForAdditionalIdentity(t *testing.T) {
+	serverPriv, _, err := ci.GenerateECDSAKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondPriv, _, err := ci.GenerateECDSAKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondIdentity, err := NewIdentity(secondPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracer := &recordingTracer{}
+	serverTr, err := New(serverPriv, WithAdditionalIdentities(secondIdentity), WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientTr, _ := newTestTransport(t)
+	clientInsecure, serverInsecure := newDelayedPipe(t, 0)
+
+	serverErrCh := make(chan error, 1)
+	go func() {
+		_, err := serverTr.SecureInbound(context.Background(), serverInsecure)
+		serverErrCh <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := clientTr.SecureOutbound(ctx, clientInsecure, secondIdentity.localPeer); err != nil {
+		t.Fatalf("client handshake with additional identity failed: %s", err)
+	}
+	if err := <-serverErrCh; err != nil {
+		t.Fatalf("server handshake failed: %s", err)
+	}
+
+	if !containsEvent(tracer.snapshot(), "PeerVerified") {
+		t.Fatal("expected a PeerVerified event for a handshake resolving to an additional identity")
+	}
+}
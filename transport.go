@@ -1,13 +1,14 @@
 package libp2ptls
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"os"
-	"sync"
 
 	ci "github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -28,38 +29,197 @@ const errMessageSimultaneousConnect = "tls: received unexpected handshake messag
 // Transport constructs secure communication sessions for a peer.
 type Transport struct {
 	identity *Identity
+	// identities holds every Identity this Transport can answer an inbound
+	// handshake as, keyed by that Identity's peer ID. It always contains at
+	// least the primary identity. A client's peer ID hint (see
+	// Identity.ConfigForPeer) is used to pick the right one out of the set.
+	identities map[peer.ID]*Identity
 
 	localPeer peer.ID
 	privKey   ci.PrivKey
+
+	// certProvider, when set via WithCertificateProvider, sources the
+	// primary identity's handshake certificate instead of the single
+	// self-signed certificate NewIdentity would otherwise freeze in place.
+	certProvider CertificateProvider
+
+	// sessionCache, when set via WithSessionCache, enables TLS 1.3 session
+	// resumption for outbound connections, and session ticket issuance (with
+	// key rotation) for inbound ones.
+	sessionCache tls.ClientSessionCache
+
+	// tracer receives structured handshake events. Defaults to a no-op.
+	tracer Tracer
+}
+
+// Option configures a Transport created by New.
+type Option func(*Transport) error
+
+// WithAdditionalIdentities registers additional local identities that this
+// Transport's listener can answer inbound handshakes as, alongside the
+// identity derived from the private key passed to New. This allows a single
+// listening socket to terminate TLS for several libp2p keys; the right
+// Identity is selected using the peer ID hint the client advertises in
+// Identity.ConfigForPeer.
+func WithAdditionalIdentities(identities ...*Identity) Option {
+	return func(t *Transport) error {
+		for _, id := range identities {
+			t.identities[id.localPeer] = id
+		}
+		return nil
+	}
+}
+
+// WithCertificateProvider makes the Transport source its primary identity's
+// handshake certificate from p instead of generating one self-signed
+// certificate that's kept for the Transport's entire lifetime. Pass a
+// CertificateProvider returned by NewRotatingCertificateProvider to rotate
+// the certificate once it's older than the provider's interval.
+func WithCertificateProvider(p CertificateProvider) Option {
+	return func(t *Transport) error {
+		t.certProvider = p
+		return nil
+	}
+}
+
+// WithSessionCache enables TLS 1.3 session resumption, keyed by remote peer
+// ID: a repeat dial to a peer this Transport has successfully connected to
+// before can resume that session instead of running a full handshake,
+// saving a round trip. size bounds the number of peer sessions kept in
+// memory (see tls.NewLRUClientSessionCache).
+//
+// This covers only session resumption, not 0-RTT/early data: Go's standard
+// crypto/tls doesn't expose true TLS 1.3 early data for stream connections,
+// so sending application data ahead of the handshake completing - with the
+// replay-safety caveats that requires - isn't implemented here. A Transport
+// built with WithSessionCache enabled still needs a full round trip before
+// a caller can write anything, just a cheaper one.
+//
+// A Transport built with WithSessionCache must have Close called once it's
+// no longer needed, to stop the background session ticket key rotation.
+func WithSessionCache(size int) Option {
+	return func(t *Transport) error {
+		t.sessionCache = tls.NewLRUClientSessionCache(size)
+		return nil
+	}
+}
+
+// WithTracer makes the Transport report structured handshake events to t
+// instead of discarding them, so operators can wire handshakes up to their
+// own logging or metrics. See Tracer for the event types, and NewSlogTracer
+// for a ready-made adapter to log/slog.
+func WithTracer(t Tracer) Option {
+	return func(tr *Transport) error {
+		tr.tracer = t
+		return nil
+	}
 }
 
 // New creates a TLS encrypted transport
-func New(key ci.PrivKey) (*Transport, error) {
+func New(key ci.PrivKey, opts ...Option) (*Transport, error) {
 	id, err := peer.IDFromPrivateKey(key)
 	if err != nil {
 		return nil, err
 	}
 	t := &Transport{
-		localPeer: id,
-		privKey:   key,
+		localPeer:  id,
+		privKey:    key,
+		identities: make(map[peer.ID]*Identity),
+		tracer:     noopTracer{},
 	}
 
-	identity, err := NewIdentity(key)
+	for _, opt := range opts {
+		if err := opt(t); err != nil {
+			return nil, err
+		}
+	}
+
+	var identity *Identity
+	if t.certProvider != nil {
+		identity, err = NewIdentityWithCertificateProvider(key, t.certProvider)
+	} else {
+		identity, err = NewIdentity(key)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if t.sessionCache != nil {
+		identity.enableSessionResumption(t.sessionCache)
+	}
 	t.identity = identity
+	t.identities[identity.localPeer] = identity
+
+	// Every Identity this Transport can answer inbound handshakes as -
+	// the primary one and any registered via WithAdditionalIdentities -
+	// needs the configured Tracer, not just the primary: configForAnyIdentity
+	// can dispatch an inbound handshake to any of them.
+	for _, id := range t.identities {
+		id.tracer = t.tracer
+	}
 	return t, nil
 }
 
+// Close stops any background goroutines this Transport started for its
+// Identities - currently just session ticket key rotation (see
+// WithSessionCache) - across every Identity it can answer handshakes as. A
+// Transport that never enabled session resumption has nothing to stop, and
+// Close is a no-op.
+func (t *Transport) Close() error {
+	for _, id := range t.identities {
+		if err := id.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 var _ sec.SecureTransport = &Transport{}
 
 // SecureInbound runs the TLS handshake as a server.
 func (t *Transport) SecureInbound(ctx context.Context, insecure net.Conn) (sec.SecureConn, error) {
-	config, keyCh := t.identity.ConfigForAny()
+	config, keyCh := t.configForAnyIdentity()
 	return t.handshake(ctx, tls.Server(insecure, config), keyCh)
 }
 
+// configForAnyIdentity returns a tls.Config suitable for accepting a
+// connection from any peer, dispatching to the right local Identity (when
+// more than one is configured) based on the peer ID hint the client
+// advertises via ALPN. A hint that doesn't match any known identity is
+// rejected from within GetConfigForClient, failing the handshake before the
+// certificate chain is ever parsed or verified.
+func (t *Transport) configForAnyIdentity() (*tls.Config, <-chan ci.PubKey) {
+	keyCh := make(chan ci.PubKey, 1)
+	config := &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			id := t.identity
+			if hint, ok := peerIDFromALPN(hello.SupportedProtos); ok {
+				match, ok := t.identities[hint]
+				if !ok {
+					return nil, fmt.Errorf("libp2ptls: no local identity for peer ID %s", hint)
+				}
+				id = match
+			}
+			// Hand the dispatched Identity our own keyCh rather than letting
+			// it allocate its own: VerifyPeerCertificate runs synchronously
+			// within tlsConn.Handshake(), so the key is on keyCh by the time
+			// Handshake() returns, with no goroutine needed to forward it
+			// from a second channel. (On a resumed session the callback
+			// isn't invoked at all; handshake handles that case.)
+			return id.configForPeer("", keyCh), nil
+		},
+	}
+	return config, keyCh
+}
+
+// comparePeerIDs breaks a simultaneous connect tie by comparing the SHA256
+// hashes of the two peer IDs. It returns -1 if local sorts before remote, 1
+// if local sorts after remote, and 0 if they're equal.
+func comparePeerIDs(local, remote peer.ID) int {
+	localHash := sha256.Sum256([]byte(local))
+	remoteHash := sha256.Sum256([]byte(remote))
+	return bytes.Compare(localHash[:], remoteHash[:])
+}
+
 // SecureOutbound runs the TLS handshake as a client.
 // Note that SecureOutbound will not return an error if the server doesn't
 // accept the certificate. This is due to the fact that in TLS 1.3, the client
@@ -73,28 +233,33 @@ func (t *Transport) SecureOutbound(ctx context.Context, insecure net.Conn, p pee
 	if err != nil && err.Error() == errMessageSimultaneousConnect {
 		// catch the TLS alert that's still in flight
 		config, _ = t.identity.ConfigForAny()
-		fmt.Println(p, "waiting for alert")
+		t.tracer.SimultaneousConnectDetected(p)
 		err := tls.Server(insecure, config).Handshake()
 		if err == nil || err.Error() != "remote error: tls: unexpected message" {
-			fmt.Println(err)
-			return nil, errors.New("didn't receive expected TLS alert")
+			alertErr := errors.New("didn't receive expected TLS alert")
+			t.tracer.HandshakeFailed(alertErr)
+			return nil, alertErr
 		}
-		fmt.Println(p, "received alert")
+		t.tracer.AlertReceived(p)
 		// Now start the next connection attempt.
 		switch comparePeerIDs(t.localPeer, p) {
 		case 0:
 			return nil, errors.New("tried to simultaneous connect to oneself")
 		case -1:
-			fmt.Println(p, "Retrying as a client")
+			t.tracer.RetryingAsClient(p)
 			// SHA256(our peer ID) is smaller than SHA256(their peer ID).
 			// We're the client in the next connection attempt.
 			config, keyCh := t.identity.ConfigForPeer(p)
 			return t.handshake(ctx, tls.Client(insecure, config), keyCh)
 		case 1:
-			fmt.Println(p, "Retrying as a server")
+			t.tracer.RetryingAsServer(p)
 			// SHA256(our peer ID) is larger than SHA256(their peer ID).
 			// We're the server in the next connection attempt.
 			config, keyCh := t.identity.ConfigForPeer(p)
+			// ConfigForPeer sets p's own peer ID as the only ALPN protocol,
+			// but p's client offers our peer ID instead; with no protocol in
+			// common crypto/tls would reject its ClientHello.
+			config.NextProtos = nil
 			return t.handshake(ctx, tls.Server(insecure, config), keyCh)
 		default:
 			panic("unexpected peer ID comparison result")
@@ -108,35 +273,12 @@ func (t *Transport) handshake(
 	tlsConn *tls.Conn,
 	keyCh <-chan ci.PubKey,
 ) (sec.SecureConn, error) {
-	// There's no way to pass a context to tls.Conn.Handshake().
-	// See https://github.com/golang/go/issues/18482.
-	// Close the connection instead.
-	select {
-	case <-ctx.Done():
-		tlsConn.Close()
-	default:
-	}
-
-	done := make(chan struct{})
-	var wg sync.WaitGroup
-
-	// Ensure that we do not return before
-	// either being done or having a context
-	// cancellation.
-	defer wg.Wait()
-	defer close(done)
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		select {
-		case <-done:
-		case <-ctx.Done():
-			tlsConn.Close()
+	if err := doHandshake(ctx, tlsConn); err != nil {
+		// The simultaneous-connect recovery path in SecureOutbound traces
+		// this error itself; don't also report it as a generic failure.
+		if err.Error() != errMessageSimultaneousConnect {
+			t.tracer.HandshakeFailed(err)
 		}
-	}()
-
-	if err := tlsConn.Handshake(); err != nil {
 		// if the context was canceled, return the context error
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return nil, ctxErr
@@ -150,6 +292,16 @@ func (t *Transport) handshake(
 	case remotePubKey = <-keyCh:
 	default:
 	}
+	if state := tlsConn.ConnectionState(); remotePubKey == nil && state.DidResume {
+		// VerifyPeerCertificate isn't invoked on a resumed session. The
+		// peer's certificate was verified when the session was first
+		// established, and crypto/tls restores it from the session state.
+		pubKey, err := pubKeyFromCertChain(state.PeerCertificates)
+		if err != nil {
+			return nil, err
+		}
+		remotePubKey = pubKey
+	}
 	if remotePubKey == nil {
 		return nil, errors.New("go-libp2p-tls BUG: expected remote pub key to be set")
 	}
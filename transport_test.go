@@ -0,0 +1,122 @@
+package libp2ptls
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func newTestTransport(t *testing.T) (*Transport, peer.ID) {
+	t.Helper()
+	priv, _, err := ci.GenerateECDSAKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := New(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr, tr.localPeer
+}
+
+// TestRejectsMismatchedPeerIDDuringClientHello checks that a client dialing
+// peer A, but connecting to a listener answering as peer B, fails fast -
+// without ever completing (or even starting) certificate verification.
+func TestRejectsMismatchedPeerIDDuringClientHello(t *testing.T) {
+	clientTr, _ := newTestTransport(t)
+	serverTr, serverPeer := newTestTransport(t)
+	otherTr, otherPeer := newTestTransport(t)
+	_ = otherTr
+
+	clientInsecure, serverInsecure := net.Pipe()
+
+	serverErrCh := make(chan error, 1)
+	go func() {
+		_, err := serverTr.SecureInbound(context.Background(), serverInsecure)
+		serverErrCh <- err
+	}()
+
+	// The client expects to reach otherPeer, but the listener on the other
+	// end of the pipe is serverTr (serverPeer != otherPeer).
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := clientTr.SecureOutbound(ctx, clientInsecure, otherPeer)
+	if err == nil {
+		t.Fatal("expected the client to reject the mismatched peer ID, got nil error")
+	}
+
+	if serverPeer == otherPeer {
+		t.Fatal("test setup bug: serverPeer and otherPeer must differ")
+	}
+
+	// The server must have refused the client's peer ID hint from within
+	// GetConfigForClient, i.e. while processing the ClientHello.
+	select {
+	case err := <-serverErrCh:
+		if err == nil || !strings.Contains(err.Error(), "no local identity for peer ID") {
+			t.Fatalf("expected the server to reject the ClientHello's peer ID hint, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server handshake never returned")
+	}
+}
+
+// TestMultiIdentitySelectsRequestedIdentity checks that a single Transport
+// configured with WithAdditionalIdentities answers as whichever identity the
+// client's peer ID hint selects.
+func TestMultiIdentitySelectsRequestedIdentity(t *testing.T) {
+	serverTr, serverPeer := newTestTransport(t)
+	secondPriv, _, err := ci.GenerateECDSAKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondIdentity, err := NewIdentity(secondPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverTr.identities[secondIdentity.localPeer] = secondIdentity
+
+	for _, expected := range []peer.ID{serverPeer, secondIdentity.localPeer} {
+		expected := expected
+		clientTr, _ := newTestTransport(t)
+		clientInsecure, serverInsecure := net.Pipe()
+
+		serverConnCh := make(chan interface{ RemotePeer() peer.ID }, 1)
+		serverErrCh := make(chan error, 1)
+		go func() {
+			c, err := serverTr.SecureInbound(context.Background(), serverInsecure)
+			if err != nil {
+				serverErrCh <- err
+				return
+			}
+			serverConnCh <- c
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		clientConn, err := clientTr.SecureOutbound(ctx, clientInsecure, expected)
+		cancel()
+		if err != nil {
+			t.Fatalf("client handshake with expected identity %s failed: %s", expected, err)
+		}
+		if clientConn.RemotePeer() != expected {
+			t.Fatalf("expected remote peer %s, got %s", expected, clientConn.RemotePeer())
+		}
+
+		select {
+		case c := <-serverConnCh:
+			if c.RemotePeer() != clientTr.localPeer {
+				t.Fatalf("server saw unexpected remote peer %s", c.RemotePeer())
+			}
+		case err := <-serverErrCh:
+			t.Fatalf("server handshake failed: %s", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("server handshake never returned")
+		}
+	}
+}